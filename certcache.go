@@ -0,0 +1,114 @@
+package appstore
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"sync"
+	"time"
+)
+
+// leafKeyCache is a bounded LRU cache of verified leaf-certificate public
+// keys, keyed by the leaf certificate's SubjectKeyIdentifier, so repeat
+// verifications of the same Apple signing key skip re-parsing and
+// re-verifying the whole x5c chain. Entries expire at the leaf
+// certificate's NotAfter so a cached key is never trusted past its own
+// validity period.
+type leafKeyCache struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type leafKeyCacheEntry struct {
+	ski      string
+	key      *ecdsa.PublicKey
+	notAfter time.Time
+}
+
+const defaultLeafKeyCacheCapacity = 256
+
+func newLeafKeyCache(capacity int) *leafKeyCache {
+	if capacity <= 0 {
+		capacity = defaultLeafKeyCacheCapacity
+	}
+	return &leafKeyCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *leafKeyCache) get(ski string) (*ecdsa.PublicKey, bool) {
+	if ski == "" {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[ski]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*leafKeyCacheEntry)
+	if !entry.notAfter.IsZero() && time.Now().After(entry.notAfter) {
+		c.ll.Remove(el)
+		delete(c.items, ski)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return entry.key, true
+}
+
+// put caches key for ski until notAfter, the signing leaf certificate's
+// own expiry. A zero notAfter never expires on its own, relying solely on
+// LRU eviction.
+func (c *leafKeyCache) put(ski string, key *ecdsa.PublicKey, notAfter time.Time) {
+	if ski == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[ski]; ok {
+		entry := el.Value.(*leafKeyCacheEntry)
+		entry.key = key
+		entry.notAfter = notAfter
+		c.ll.MoveToFront(el)
+		return
+	}
+	el := c.ll.PushFront(&leafKeyCacheEntry{ski: ski, key: key, notAfter: notAfter})
+	c.items[ski] = el
+	if c.ll.Len() > c.capacity {
+		if oldest := c.ll.Back(); oldest != nil {
+			c.ll.Remove(oldest)
+			delete(c.items, oldest.Value.(*leafKeyCacheEntry).ski)
+		}
+	}
+}
+
+// rootCertPool pins the Apple root certificate(s) verifiedLeafCert will accept,
+// letting callers rotate roots without a library upgrade.
+type rootCertPool struct {
+	certs []*x509.Certificate
+}
+
+func newRootCertPool(certs []*x509.Certificate) *rootCertPool {
+	if len(certs) == 0 {
+		return nil
+	}
+	return &rootCertPool{certs: certs}
+}
+
+// contains reports whether cert is one of the pinned roots. A nil pool
+// means no pinning was configured, so every root is accepted.
+func (p *rootCertPool) contains(cert *x509.Certificate) bool {
+	if p == nil {
+		return true
+	}
+	for _, root := range p.certs {
+		if root.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,312 @@
+package appstore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HistoryIterator streams GetTransactionHistory one page at a time so
+// callers can cancel mid-stream or checkpoint on Revision instead of
+// buffering the whole history in memory.
+type HistoryIterator struct {
+	ctx    context.Context
+	owner  *StoreClient
+	client HTTPClient
+	url    string
+	query  url.Values
+	cur    *HistoryResponse
+	err    error
+	done   bool
+}
+
+// TransactionHistoryIterator returns an iterator over the pages of
+// GetTransactionHistory for originalTransactionId.
+func (c *StoreClient) TransactionHistoryIterator(ctx context.Context, originalTransactionId string, query *url.Values) *HistoryIterator {
+	URL := c.hostUrl + PathTransactionHistory
+	URL = strings.Replace(URL, "{originalTransactionId}", originalTransactionId, -1)
+
+	if query == nil {
+		query = &url.Values{}
+	}
+
+	client := c.httpClient(EndpointTransactions)
+	client = RequireResponseStatus(client, http.StatusOK)
+
+	return &HistoryIterator{ctx: ctx, owner: c, client: client, url: URL, query: *query}
+}
+
+// Next fetches the next page of transaction history. It returns false
+// once there are no more pages or a request fails; check Err afterwards.
+func (it *HistoryIterator) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+
+	rsp := HistoryResponse{}
+	client := SetResponseBodyHandler(it.client, json.Unmarshal, &rsp)
+	req, err := http.NewRequestWithContext(it.ctx, http.MethodGet, it.url+"?"+it.query.Encode(), nil)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if _, err := client.Do(req); err != nil {
+		it.err = err
+		return false
+	}
+
+	it.cur = &rsp
+	if !rsp.HasMore || rsp.Revision == "" {
+		it.done = true
+	} else {
+		it.query.Set("revision", rsp.Revision)
+	}
+	return true
+}
+
+// Value returns the page most recently fetched by Next.
+func (it *HistoryIterator) Value() *HistoryResponse {
+	return it.cur
+}
+
+// Ack persists the transactions in the page most recently fetched by
+// Next, if a Store is configured. Call it once the caller is done
+// handling Value() — persisting only on acknowledgement means a crash
+// between Next and Ack leaves the page unprocessed on resume, instead of
+// the Store silently marking it handled before it actually was.
+func (it *HistoryIterator) Ack() {
+	if it.cur == nil {
+		return
+	}
+	ackSignedTransactions(it.owner, it.cur.SignedTransactions)
+}
+
+// Err returns the error, if any, that stopped iteration.
+func (it *HistoryIterator) Err() error {
+	return it.err
+}
+
+// Close releases resources held by the iterator.
+func (it *HistoryIterator) Close() {}
+
+// GetTransactionHistory https://developer.apple.com/documentation/appstoreserverapi/get_transaction_history
+func (c *StoreClient) GetTransactionHistory(ctx context.Context, originalTransactionId string, query *url.Values) (responses []*HistoryResponse, err error) {
+	it := c.TransactionHistoryIterator(ctx, originalTransactionId, query)
+	for it.Next() {
+		responses = append(responses, it.Value())
+	}
+	return responses, it.Err()
+}
+
+// RefundHistoryIterator streams GetRefundHistory one page at a time.
+type RefundHistoryIterator struct {
+	ctx     context.Context
+	owner   *StoreClient
+	client  HTTPClient
+	baseURL string
+	url     string
+	cur     *RefundLookupResponse
+	err     error
+	done    bool
+}
+
+// RefundHistoryIterator returns an iterator over the pages of
+// GetRefundHistory for originalTransactionId.
+func (c *StoreClient) RefundHistoryIterator(ctx context.Context, originalTransactionId string) *RefundHistoryIterator {
+	baseURL := c.hostUrl + PathRefundHistory
+	baseURL = strings.Replace(baseURL, "{originalTransactionId}", originalTransactionId, -1)
+
+	client := c.httpClient(EndpointTransactions)
+	client = RequireResponseStatus(client, http.StatusOK)
+
+	return &RefundHistoryIterator{ctx: ctx, owner: c, client: client, baseURL: baseURL, url: baseURL}
+}
+
+// Next fetches the next page of refund history. It returns false once
+// there are no more pages or a request fails; check Err afterwards.
+func (it *RefundHistoryIterator) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+
+	rsp := RefundLookupResponse{}
+	client := SetResponseBodyHandler(it.client, json.Unmarshal, &rsp)
+	req, err := http.NewRequestWithContext(it.ctx, http.MethodGet, it.url, nil)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if _, err := client.Do(req); err != nil {
+		it.err = err
+		return false
+	}
+
+	it.cur = &rsp
+	if !rsp.HasMore || rsp.Revision == "" {
+		it.done = true
+		return true
+	}
+
+	data := url.Values{}
+	data.Set("revision", rsp.Revision)
+	it.url = it.baseURL + "?" + data.Encode()
+	return true
+}
+
+// Value returns the page most recently fetched by Next.
+func (it *RefundHistoryIterator) Value() *RefundLookupResponse {
+	return it.cur
+}
+
+// Ack persists the transactions in the page most recently fetched by
+// Next, if a Store is configured. Call it once the caller is done
+// handling Value() — see HistoryIterator.Ack for why persistence waits
+// for acknowledgement instead of happening inside Next.
+func (it *RefundHistoryIterator) Ack() {
+	if it.cur == nil {
+		return
+	}
+	ackSignedTransactions(it.owner, it.cur.SignedTransactions)
+}
+
+// Err returns the error, if any, that stopped iteration.
+func (it *RefundHistoryIterator) Err() error {
+	return it.err
+}
+
+// Close releases resources held by the iterator.
+func (it *RefundHistoryIterator) Close() {}
+
+// GetRefundHistory https://developer.apple.com/documentation/appstoreserverapi/get_refund_history
+func (c *StoreClient) GetRefundHistory(ctx context.Context, originalTransactionId string) (responses []*RefundLookupResponse, err error) {
+	it := c.RefundHistoryIterator(ctx, originalTransactionId)
+	for it.Next() {
+		responses = append(responses, it.Value())
+	}
+	return responses, it.Err()
+}
+
+// NotificationHistoryIterator streams GetNotificationHistory one page at
+// a time.
+type NotificationHistoryIterator struct {
+	ctx     context.Context
+	owner   *StoreClient
+	client  HTTPClient
+	baseURL string
+	url     string
+	body    NotificationHistoryRequest
+	cur     *NotificationHistoryResponses
+	err     error
+	done    bool
+}
+
+// NotificationHistoryIterator returns an iterator over the pages of
+// GetNotificationHistory matching body.
+func (c *StoreClient) NotificationHistoryIterator(ctx context.Context, body NotificationHistoryRequest) *NotificationHistoryIterator {
+	baseURL := c.hostUrl + PathGetNotificationHistory
+
+	client := c.httpClient(EndpointNotifications)
+	client = RequireResponseStatus(client, http.StatusOK)
+
+	return &NotificationHistoryIterator{ctx: ctx, owner: c, client: client, baseURL: baseURL, url: baseURL, body: body}
+}
+
+// Next fetches the next page of notification history. It returns false
+// once there are no more pages or a request fails; check Err afterwards.
+func (it *NotificationHistoryIterator) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+
+	rsp := NotificationHistoryResponses{}
+	rsp.NotificationHistory = make([]NotificationHistoryResponseItem, 0)
+
+	client := SetRequestBodyJSON(it.client, it.body)
+	client = SetResponseBodyHandler(client, json.Unmarshal, &rsp)
+
+	req, err := http.NewRequestWithContext(it.ctx, http.MethodPost, it.url, nil)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if _, err := client.Do(req); err != nil {
+		it.err = err
+		return false
+	}
+
+	it.cur = &rsp
+	if !rsp.HasMore || rsp.PaginationToken == "" {
+		it.done = true
+		return true
+	}
+
+	data := url.Values{}
+	data.Set("paginationToken", rsp.PaginationToken)
+	it.url = it.baseURL + "?" + data.Encode()
+	return true
+}
+
+// Value returns the page most recently fetched by Next.
+func (it *NotificationHistoryIterator) Value() *NotificationHistoryResponses {
+	return it.cur
+}
+
+// Ack persists the notifications in the page most recently fetched by
+// Next, if a Store is configured. Call it once the caller is done
+// handling Value() — see HistoryIterator.Ack for why persistence waits
+// for acknowledgement instead of happening inside Next.
+func (it *NotificationHistoryIterator) Ack() {
+	if it.cur == nil {
+		return
+	}
+	ackNotifications(it.owner, it.cur.NotificationHistory)
+}
+
+// Err returns the error, if any, that stopped iteration.
+func (it *NotificationHistoryIterator) Err() error {
+	return it.err
+}
+
+// Close releases resources held by the iterator.
+func (it *NotificationHistoryIterator) Close() {}
+
+// GetNotificationHistory https://developer.apple.com/documentation/appstoreserverapi/get_notification_history
+func (c *StoreClient) GetNotificationHistory(ctx context.Context, body NotificationHistoryRequest) (responses []NotificationHistoryResponseItem, err error) {
+	it := c.NotificationHistoryIterator(ctx, body)
+	for it.Next() {
+		responses = append(responses, it.Value().NotificationHistory...)
+	}
+	return responses, it.Err()
+}
+
+// ackSignedTransactions persists signedTransactions via owner's Store, if
+// any is configured. Shared by HistoryIterator.Ack and
+// RefundHistoryIterator.Ack, which both page through signed transactions.
+func ackSignedTransactions(owner *StoreClient, signedTransactions []string) {
+	if owner.store == nil {
+		return
+	}
+	for _, signedTransaction := range signedTransactions {
+		// Best-effort: a malformed or already-processed transaction must
+		// not abort acknowledgement of the rest of the page.
+		_, _ = owner.ParseSignedTransaction(signedTransaction)
+	}
+}
+
+// ackNotifications persists items via owner's Store, if any is
+// configured. Shared with NotificationHistoryIterator.Ack.
+func ackNotifications(owner *StoreClient, items []NotificationHistoryResponseItem) {
+	if owner.store == nil {
+		return
+	}
+	for _, item := range items {
+		if item.SignedPayload == "" {
+			continue
+		}
+		// Best-effort: a malformed or already-processed item must not
+		// abort acknowledgement of the rest of the page.
+		_, _ = owner.ParseNotificationV2(item.SignedPayload)
+	}
+}
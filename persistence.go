@@ -0,0 +1,82 @@
+package appstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNotificationAlreadyProcessed is returned by ParseNotificationV2 when
+// a Store is configured and the notification's UUID has already been
+// recorded via PutNotification.
+var ErrNotificationAlreadyProcessed = errors.New("appstore: notification already processed")
+
+// Store persists decoded JWS payloads and notification UUIDs. Apple
+// resends notifications on failure, so callers need somewhere to check
+// "have I already handled this one" — HasProcessedNotification is that
+// seam. A nil Store disables persistence entirely.
+//
+// Implementations are expected to be safe for concurrent use. Ship a
+// Redis/SQL/BoltDB-backed Store by implementing this interface; see
+// MemoryStore for a reference implementation.
+type Store interface {
+	PutTransaction(ctx context.Context, transaction *JWSTransaction) error
+	GetTransaction(ctx context.Context, transactionId string) (*JWSTransaction, error)
+	PutNotification(ctx context.Context, notification *NotificationPayload) error
+	PutRenewalInfo(ctx context.Context, renewalInfo *JWSRenewalInfoDecodedPayload) error
+	// HasProcessedNotification reports whether a notification with uuid
+	// has already been persisted via PutNotification.
+	HasProcessedNotification(ctx context.Context, uuid string) (bool, error)
+}
+
+// MemoryStore is an in-memory reference Store, useful for tests and
+// single-process deployments. It does not survive a process restart.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	transactions  map[string]*JWSTransaction
+	notifications map[string]*NotificationPayload
+	renewalInfos  map[string]*JWSRenewalInfoDecodedPayload
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		transactions:  make(map[string]*JWSTransaction),
+		notifications: make(map[string]*NotificationPayload),
+		renewalInfos:  make(map[string]*JWSRenewalInfoDecodedPayload),
+	}
+}
+
+func (s *MemoryStore) PutTransaction(_ context.Context, transaction *JWSTransaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transactions[transaction.TransactionId] = transaction
+	return nil
+}
+
+func (s *MemoryStore) GetTransaction(_ context.Context, transactionId string) (*JWSTransaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.transactions[transactionId], nil
+}
+
+func (s *MemoryStore) PutNotification(_ context.Context, notification *NotificationPayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifications[notification.NotificationUUID] = notification
+	return nil
+}
+
+func (s *MemoryStore) PutRenewalInfo(_ context.Context, renewalInfo *JWSRenewalInfoDecodedPayload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.renewalInfos[renewalInfo.OriginalTransactionId] = renewalInfo
+	return nil
+}
+
+func (s *MemoryStore) HasProcessedNotification(_ context.Context, uuid string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.notifications[uuid]
+	return ok, nil
+}
@@ -0,0 +1,172 @@
+package appstore
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoint identifies one of Apple's documented rate-limit quotas so a
+// caller can tune limits per quota instead of a single global limit.
+type Endpoint string
+
+const (
+	EndpointTransactions  Endpoint = "transactions"
+	EndpointSubscriptions Endpoint = "subscriptions"
+	EndpointNotifications Endpoint = "notifications"
+	EndpointMassExtend    Endpoint = "mass_extend"
+)
+
+// RateLimiter gates how fast requests are allowed to proceed. Wait blocks
+// until a request may proceed or ctx is done.
+type RateLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// Pauser lets a RateLimiter be told to back off for a fixed duration, e.g.
+// in response to a Retry-After header.
+type Pauser interface {
+	PauseFor(d time.Duration)
+}
+
+// RateLimiters maps an Endpoint to the RateLimiter guarding it. A missing
+// or nil entry leaves that endpoint unthrottled.
+type RateLimiters map[Endpoint]RateLimiter
+
+func (r RateLimiters) forEndpoint(e Endpoint) RateLimiter {
+	if r == nil {
+		return nil
+	}
+	return r[e]
+}
+
+// TokenBucketLimiter is a dependency-free token-bucket RateLimiter. Tokens
+// are added at ratePerSecond up to burst capacity; Wait blocks until a
+// token is available or ctx is done.
+type TokenBucketLimiter struct {
+	mu       sync.Mutex
+	rate     float64
+	burst    float64
+	tokens   float64
+	last     time.Time
+	pausedTo time.Time
+}
+
+// NewTokenBucketLimiter creates a TokenBucketLimiter that allows
+// ratePerSecond requests per second, up to burst requests at once.
+func NewTokenBucketLimiter(ratePerSecond float64, burst int) *TokenBucketLimiter {
+	return &TokenBucketLimiter{
+		rate:   ratePerSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// PauseFor suspends the limiter for d, extending any pause already in
+// effect. Used to honor a Retry-After header from Apple.
+func (l *TokenBucketLimiter) PauseFor(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.pausedTo) {
+		l.pausedTo = until
+	}
+}
+
+func (l *TokenBucketLimiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		if wait := l.pausedTo.Sub(now); wait > 0 {
+			l.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+				continue
+			}
+		}
+
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// WithRateLimit wraps client so every request first blocks on limiter.
+// On a 429 or 503 response it honors the Retry-After header by pausing
+// limiter for that duration, ahead of whatever backoff WithRetryPolicy
+// applies when wrapped around this. Wrap WithRateLimit closest to the
+// transport so the limiter gates every attempt a retry loop makes, not
+// just the logical call. A nil limiter is a no-op.
+func WithRateLimit(client HTTPClient, limiter RateLimiter) HTTPClient {
+	if limiter == nil {
+		return client
+	}
+
+	var do DoFunc = func(req *http.Request) (*http.Response, error) {
+		if err := limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+			if pause, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				if p, ok := limiter.(Pauser); ok {
+					p.PauseFor(pause)
+				}
+			}
+		}
+		return resp, err
+	}
+	return do
+}
+
+// retryAfter parses a Retry-After header, which Apple sends either as a
+// number of seconds or an HTTP-date.
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t), true
+	}
+	return 0, false
+}
+
+// endpointForURL classifies a request URL into the Apple quota bucket it
+// falls under, for call sites that only have a URL to go on.
+func endpointForURL(url string) Endpoint {
+	switch {
+	case strings.Contains(url, "/subscriptions/extend/mass"):
+		return EndpointMassExtend
+	case strings.Contains(url, "/subscriptions"):
+		return EndpointSubscriptions
+	case strings.Contains(url, "/notifications"):
+		return EndpointNotifications
+	default:
+		return EndpointTransactions
+	}
+}
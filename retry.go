@@ -0,0 +1,195 @@
+package appstore
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryDecision is the outcome of classifying a response/error pair for
+// retry purposes.
+type RetryDecision int
+
+const (
+	// RetryStop means the response/error is final; do not retry.
+	RetryStop RetryDecision = iota
+	// RetryRetry means back off and retry the request.
+	RetryRetry
+	// RetryRefreshToken means the auth token is stale; refresh it and
+	// retry once, outside of MaxAttempts.
+	RetryRefreshToken
+)
+
+// RetryPolicy configures how StoreClient retries failed requests.
+// Zero-valued fields fall back to defaults: MaxAttempts 3, InitialBackoff
+// 200ms, MaxBackoff 5s, Multiplier 2, Jitter 0.2 and Classify
+// DefaultRetryClassifier. A zero Jitter therefore selects the default
+// rather than disabling jitter.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+	Classify       func(resp *http.Response, err error) RetryDecision
+}
+
+func (p *RetryPolicy) withDefaults() *RetryPolicy {
+	merged := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		Classify:       DefaultRetryClassifier,
+	}
+	if p == nil {
+		return &merged
+	}
+	if p.MaxAttempts > 0 {
+		merged.MaxAttempts = p.MaxAttempts
+	}
+	if p.InitialBackoff > 0 {
+		merged.InitialBackoff = p.InitialBackoff
+	}
+	if p.MaxBackoff > 0 {
+		merged.MaxBackoff = p.MaxBackoff
+	}
+	if p.Multiplier > 0 {
+		merged.Multiplier = p.Multiplier
+	}
+	if p.Jitter > 0 {
+		merged.Jitter = p.Jitter
+	}
+	if p.Classify != nil {
+		merged.Classify = p.Classify
+	}
+	return &merged
+}
+
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt))
+	if max := float64(p.MaxBackoff); d > max {
+		d = max
+	}
+	if p.Jitter > 0 {
+		d *= 1 + (rand.Float64()*2-1)*p.Jitter
+	}
+	return time.Duration(d)
+}
+
+// DefaultRetryClassifier retries on the documented transient Apple error
+// codes and on 5xx/429 responses, refreshes the auth token once on a 401
+// instead of retrying it blindly, and otherwise stops.
+func DefaultRetryClassifier(resp *http.Response, err error) RetryDecision {
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return RetryRetry
+		}
+		return RetryStop
+	}
+	if resp == nil {
+		return RetryStop
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return RetryRefreshToken
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusServiceUnavailable,
+		resp.StatusCode >= 500:
+		return RetryRetry
+	}
+
+	if resp.StatusCode >= 400 && resp.Body != nil {
+		body, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr == nil {
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			if apiErr, ok := newAppStoreAPIError(body, resp.Header); ok {
+				switch apiErr.ErrorCode {
+				case GeneralInternalRetryableError, AccountNotFoundRetryableError:
+					return RetryRetry
+				}
+			}
+		}
+	}
+	return RetryStop
+}
+
+// WithRetryPolicy wraps client so it retries per policy (nil selects
+// RetryPolicy's defaults). On RetryRefreshToken it calls refreshToken
+// once and retries the request a single additional time, independent of
+// MaxAttempts; refreshToken may be nil to disable that behavior.
+func WithRetryPolicy(client HTTPClient, policy *RetryPolicy, refreshToken func() error) HTTPClient {
+	policy = policy.withDefaults()
+
+	var do DoFunc = func(req *http.Request) (*http.Response, error) {
+		var resp *http.Response
+		var err error
+		refreshed := false
+
+		for attempt := 0; attempt < policy.MaxAttempts; {
+			if (attempt > 0 || refreshed) && req.GetBody != nil {
+				body, berr := req.GetBody()
+				if berr != nil {
+					return resp, berr
+				}
+				req.Body = body
+			}
+
+			resp, err = client.Do(req)
+
+			switch policy.Classify(resp, err) {
+			case RetryRetry:
+				if attempt+1 >= policy.MaxAttempts {
+					return resp, err
+				}
+				pause, ok := retryAfter(retryAfterHeader(resp))
+				if !ok {
+					pause = policy.backoff(attempt)
+				}
+				drainAndClose(resp)
+				time.Sleep(pause)
+				attempt++
+			case RetryRefreshToken:
+				if refreshed || refreshToken == nil {
+					return resp, err
+				}
+				refreshed = true
+				if rerr := refreshToken(); rerr != nil {
+					return resp, err
+				}
+				drainAndClose(resp)
+				// A refresh-retry is a one-shot outside of MaxAttempts, so
+				// it doesn't consume an attempt.
+			default:
+				return resp, err
+			}
+		}
+		return resp, err
+	}
+	return do
+}
+
+func retryAfterHeader(resp *http.Response) string {
+	if resp == nil {
+		return ""
+	}
+	return resp.Header.Get("Retry-After")
+}
+
+// drainAndClose discards any unread body of a discarded response so its
+// connection can be reused, per http.Client's documented requirement that
+// a response body be read to completion and closed.
+func drainAndClose(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
@@ -7,11 +7,9 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"strings"
 	"time"
 
@@ -42,13 +40,43 @@ type StoreConfig struct {
 	BundleID   string // Your app’s bundle ID
 	Issuer     string // Your issuer ID from the Keys page in App Store Connect (Ex: "57246542-96fe-1a63-e053-0824d011072a")
 	Sandbox    bool   // default is Production
+
+	// RateLimiters optionally throttles requests per Apple quota bucket
+	// (see Endpoint). Endpoints with no entry are left unthrottled.
+	RateLimiters RateLimiters
+
+	// Store optionally persists decoded transactions and notifications,
+	// and deduplicates resent notifications. A nil Store disables
+	// persistence entirely.
+	Store Store
+
+	// RetryPolicy tunes how failed requests are retried. A nil
+	// RetryPolicy uses the defaults documented on RetryPolicy.
+	RetryPolicy *RetryPolicy
+
+	// RootCertificates pins the Apple root certificate(s) JWS verification
+	// trusts, instead of relying on the embedded default. Rotate roots
+	// by updating this list rather than upgrading the library.
+	RootCertificates []*x509.Certificate
+
+	// OfflineVerify fails closed if the x5c chain cannot be verified
+	// against RootCertificates, for air-gapped test harnesses or offline
+	// batch processing with no other trust source available. Requires
+	// RootCertificates to be set.
+	OfflineVerify bool
 }
 
 type StoreClient struct {
-	Token   *Token
-	httpCli *http.Client
-	cert    *Cert
-	hostUrl string
+	Token         *Token
+	httpCli       *http.Client
+	cert          *Cert
+	hostUrl       string
+	limiters      RateLimiters
+	store         Store
+	retryPolicy   *RetryPolicy
+	rootCertPool  *rootCertPool
+	offlineVerify bool
+	leafKeys      *leafKeyCache
 }
 
 // NewStoreClient create a appstore server api client
@@ -66,7 +94,13 @@ func NewStoreClient(config *StoreConfig) *StoreClient {
 		httpCli: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		hostUrl: hostUrl,
+		hostUrl:       hostUrl,
+		limiters:      config.RateLimiters,
+		store:         config.Store,
+		retryPolicy:   config.RetryPolicy,
+		rootCertPool:  newRootCertPool(config.RootCertificates),
+		offlineVerify: config.OfflineVerify,
+		leafKeys:      newLeafKeyCache(0),
 	}
 	return client
 }
@@ -81,16 +115,22 @@ func NewStoreClientWithHTTPClient(config *StoreConfig, httpClient *http.Client)
 	}
 
 	client := &StoreClient{
-		Token:   token,
-		cert:    &Cert{},
-		httpCli: httpClient,
-		hostUrl: hostUrl,
+		Token:         token,
+		cert:          &Cert{},
+		httpCli:       httpClient,
+		hostUrl:       hostUrl,
+		limiters:      config.RateLimiters,
+		store:         config.Store,
+		retryPolicy:   config.RetryPolicy,
+		rootCertPool:  newRootCertPool(config.RootCertificates),
+		offlineVerify: config.OfflineVerify,
+		leafKeys:      newLeafKeyCache(0),
 	}
 	return client
 }
 
-func (c *StoreClient) httpClient() HTTPClient {
-	var client DoFunc = func(req *http.Request) (*http.Response, error) {
+func (c *StoreClient) httpClient(endpoint Endpoint) HTTPClient {
+	var client HTTPClient = DoFunc(func(req *http.Request) (*http.Response, error) {
 		authToken, err := c.Token.GenerateIfExpired()
 		if err != nil {
 			return nil, fmt.Errorf("appstore generate token err %w", err)
@@ -98,65 +138,21 @@ func (c *StoreClient) httpClient() HTTPClient {
 		req.Header.Set("Authorization", "Bearer "+authToken)
 		req.Header.Set("User-Agent", "App Store Client")
 		return c.httpCli.Do(req)
-	}
-
-	client = SetRetry(client, &JitterBackoff{}, func(i int, err error) bool {
-		if i == http.StatusUnauthorized {
-			return true
-		}
-		if errors.Is(err, io.ErrUnexpectedEOF) {
-			return true
-		}
+	})
 
-		if errors.Is(err, io.EOF) {
-			return true
-		}
-		return false
+	client = WithRateLimit(client, c.limiters.forEndpoint(endpoint))
+	client = WithRetryPolicy(client, c.retryPolicy, func() error {
+		_, err := c.Token.GenerateIfExpired()
+		return err
 	})
 	return client
 }
 
-// GetTransactionHistory https://developer.apple.com/documentation/appstoreserverapi/get_transaction_history
-func (c *StoreClient) GetTransactionHistory(ctx context.Context, originalTransactionId string, query *url.Values) (responses []*HistoryResponse, err error) {
-	URL := c.hostUrl + PathTransactionHistory
-	URL = strings.Replace(URL, "{originalTransactionId}", originalTransactionId, -1)
-
-	if query == nil {
-		query = &url.Values{}
-	}
-
-	client := c.httpClient()
-	client = RequireResponseStatus(client, http.StatusOK)
-
-	for {
-		rsp := HistoryResponse{}
-		client = SetResponseBodyHandler(client, json.Unmarshal, &rsp)
-		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, URL+"?"+query.Encode(), nil)
-		_, err = client.Do(req)
-		if err != nil {
-			return nil, err
-		}
-
-		responses = append(responses, &rsp)
-		if !rsp.HasMore {
-			return
-		}
-
-		if rsp.Revision != "" {
-			query.Set("revision", rsp.Revision)
-		} else {
-			return
-		}
-
-		time.Sleep(10 * time.Millisecond)
-	}
-}
-
 // GetALLSubscriptionStatuses https://developer.apple.com/documentation/appstoreserverapi/get_all_subscription_statuses
 func (c *StoreClient) GetALLSubscriptionStatuses(ctx context.Context, originalTransactionId string) (*StatusResponse, error) {
 	URL := c.hostUrl + PathGetALLSubscriptionStatus
 	URL = strings.Replace(URL, "{originalTransactionId}", originalTransactionId, -1)
-	client := c.httpClient()
+	client := c.httpClient(EndpointSubscriptions)
 	client = RequireResponseStatus(client, http.StatusOK)
 	rsp := &StatusResponse{}
 	client = SetResponseBodyHandler(client, json.Unmarshal, rsp)
@@ -173,7 +169,7 @@ func (c *StoreClient) GetTransactionInfo(ctx context.Context, transactionId stri
 	URL := c.hostUrl + PathTransactionInfo
 	URL = strings.Replace(URL, "{transactionId}", transactionId, -1)
 
-	client := c.httpClient()
+	client := c.httpClient(EndpointTransactions)
 	client = RequireResponseStatus(client, http.StatusOK)
 
 	rsp := &TransactionInfoResponse{}
@@ -191,7 +187,7 @@ func (c *StoreClient) LookupOrderID(ctx context.Context, orderId string) (*Order
 	URL := c.hostUrl + PathLookUp
 	URL = strings.Replace(URL, "{orderId}", orderId, -1)
 	rsp := &OrderLookupResponse{}
-	client := c.httpClient()
+	client := c.httpClient(EndpointTransactions)
 	client = RequireResponseStatus(client, http.StatusOK)
 	client = SetResponseBodyHandler(client, json.Unmarshal, rsp)
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, URL, nil)
@@ -202,41 +198,6 @@ func (c *StoreClient) LookupOrderID(ctx context.Context, orderId string) (*Order
 	return rsp, nil
 }
 
-// GetRefundHistory https://developer.apple.com/documentation/appstoreserverapi/get_refund_history
-func (c *StoreClient) GetRefundHistory(ctx context.Context, originalTransactionId string) (responses []*RefundLookupResponse, err error) {
-	baseURL := c.hostUrl + PathRefundHistory
-	baseURL = strings.Replace(baseURL, "{originalTransactionId}", originalTransactionId, -1)
-
-	URL := baseURL
-	client := c.httpClient()
-	client = RequireResponseStatus(client, http.StatusOK)
-
-	for {
-		rsp := RefundLookupResponse{}
-		client = SetResponseBodyHandler(client, json.Unmarshal, &rsp)
-		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, URL, nil)
-		_, err = client.Do(req)
-		if err != nil {
-			return nil, err
-		}
-
-		responses = append(responses, &rsp)
-		if !rsp.HasMore {
-			return
-		}
-
-		data := url.Values{}
-		if rsp.Revision != "" {
-			data.Set("revision", rsp.Revision)
-			URL = baseURL + "?" + data.Encode()
-		} else {
-			return
-		}
-
-		time.Sleep(10 * time.Millisecond)
-	}
-}
-
 // SendConsumptionInfo https://developer.apple.com/documentation/appstoreserverapi/send_consumption_information
 func (c *StoreClient) SendConsumptionInfo(ctx context.Context, originalTransactionId string, body ConsumptionRequestBody) (statusCode int, err error) {
 	URL := c.hostUrl + PathConsumptionInfo
@@ -319,48 +280,11 @@ func (c *StoreClient) GetSubscriptionRenewalDataStatus(ctx context.Context, prod
 	return statusCode, rsp, nil
 }
 
-// GetNotificationHistory https://developer.apple.com/documentation/appstoreserverapi/get_notification_history
-func (c *StoreClient) GetNotificationHistory(ctx context.Context, body NotificationHistoryRequest) (responses []NotificationHistoryResponseItem, err error) {
-	baseURL := c.hostUrl + PathGetNotificationHistory
-	URL := baseURL
-	client := c.httpClient()
-	client = RequireResponseStatus(client, http.StatusOK)
-
-	for {
-		rsp := NotificationHistoryResponses{}
-		rsp.NotificationHistory = make([]NotificationHistoryResponseItem, 0)
-
-		client = SetRequestBodyJSON(client, body)
-		client = SetResponseBodyHandler(client, json.Unmarshal, &rsp)
-
-		req, _ := http.NewRequestWithContext(ctx, http.MethodPost, URL, nil)
-		_, err := client.Do(req)
-		if err != nil {
-			return nil, err
-		}
-
-		responses = append(responses, rsp.NotificationHistory...)
-		if !rsp.HasMore {
-			return responses, nil
-		}
-
-		data := url.Values{}
-		if rsp.PaginationToken != "" {
-			data.Set("paginationToken", rsp.PaginationToken)
-			URL = baseURL + "?" + data.Encode()
-		} else {
-			return responses, nil
-		}
-
-		time.Sleep(10 * time.Millisecond)
-	}
-}
-
 // SendRequestTestNotification https://developer.apple.com/documentation/appstoreserverapi/request_a_test_notification
 func (c *StoreClient) SendRequestTestNotification(ctx context.Context) (*TestNotificationResponse, error) {
 	URL := c.hostUrl + PathRequestTestNotification
 	var rsp = new(TestNotificationResponse)
-	client := c.httpClient()
+	client := c.httpClient(EndpointNotifications)
 	client = RequireResponseStatus(client, http.StatusOK, http.StatusNotFound, http.StatusTooManyRequests, http.StatusInternalServerError)
 	client = SetResponseBodyHandler(client, json.Unmarshal, rsp)
 	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, URL, nil)
@@ -378,8 +302,24 @@ func (c *StoreClient) GetTestNotificationStatus(ctx context.Context, testNotific
 
 func (c *StoreClient) ParseNotificationV2(tokenStr string) (*NotificationPayload, error) {
 	var ret = new(NotificationPayload)
-	c.parseJWS(tokenStr, ret)
-	return ret, c.parseJWS(tokenStr, ret)
+	if err := c.decodeJWS(tokenStr, ret); err != nil {
+		return ret, err
+	}
+
+	if c.store != nil {
+		ctx := context.Background()
+		processed, err := c.store.HasProcessedNotification(ctx, ret.NotificationUUID)
+		if err != nil {
+			return ret, err
+		}
+		if processed {
+			return ret, ErrNotificationAlreadyProcessed
+		}
+		if err := c.store.PutNotification(ctx, ret); err != nil {
+			return ret, err
+		}
+	}
+	return ret, nil
 }
 
 func (c *StoreClient) ParseNotificationV2WithClaim(tokenStr string) (jwt.Claims, error) {
@@ -418,65 +358,132 @@ func (c *StoreClient) ParseJWSEncodeString(jwsEncode string) (interface{}, error
 	// Determine which struct to use based on the payload contents
 	if strings.Contains(string(payload), "transactionId") {
 		transaction := &JWSTransaction{}
-		err = c.parseJWS(jwsEncode, transaction)
+		if err = c.decodeJWS(jwsEncode, transaction); err != nil {
+			return transaction, err
+		}
+		if c.store != nil {
+			err = c.store.PutTransaction(context.Background(), transaction)
+		}
 		return transaction, err
 	} else if strings.Contains(string(payload), "renewalDate") {
 		renewalInfo := &JWSRenewalInfoDecodedPayload{}
-		err = c.parseJWS(jwsEncode, renewalInfo)
+		if err = c.decodeJWS(jwsEncode, renewalInfo); err != nil {
+			return renewalInfo, err
+		}
+		if c.store != nil {
+			err = c.store.PutRenewalInfo(context.Background(), renewalInfo)
+		}
 		return renewalInfo, err
 	}
 
 	return nil, nil
 }
 
-func (c *StoreClient) parseJWS(jwsEncode string, claims jwt.Claims) error {
-	rootCertBytes, err := c.cert.extractCertByIndex(jwsEncode, 2)
+// decodeJWS verifies jwsEncode's leaf certificate (via verifiedLeafCert)
+// and decodes claims from it. Callers that already hold a verified leaf
+// certificate, such as VerifyJWS, should call parseJWS directly instead
+// of re-deriving it here.
+func (c *StoreClient) decodeJWS(jwsEncode string, claims jwt.Claims) error {
+	leafCert, err := c.verifiedLeafCert(jwsEncode)
 	if err != nil {
 		return err
 	}
+	return c.parseJWS(leafCert, jwsEncode, claims)
+}
+
+// parseJWS decodes claims from jwsEncode using leafCert's public key.
+// leafCert must already have been verified by verifiedLeafCert.
+func (c *StoreClient) parseJWS(leafCert *x509.Certificate, jwsEncode string, claims jwt.Claims) error {
+	pk, ok := c.leafKeys.get(string(leafCert.SubjectKeyId))
+	if !ok {
+		var okType bool
+		pk, okType = leafCert.PublicKey.(*ecdsa.PublicKey)
+		if !okType {
+			return fmt.Errorf("appstore public key must be of type ecdsa.PublicKey")
+		}
+		c.leafKeys.put(string(leafCert.SubjectKeyId), pk, leafCert.NotAfter)
+	}
+
+	_, err := jwt.ParseWithClaims(jwsEncode, claims, func(token *jwt.Token) (interface{}, error) {
+		return pk, nil
+	})
+	return err
+}
+
+// verifiedLeafCert verifies jwsEncode's x5c chain against the pinned
+// root pool (if any) and returns the leaf certificate. When OfflineVerify
+// is set it fails closed unless RootCertificates was configured.
+func (c *StoreClient) verifiedLeafCert(jwsEncode string) (*x509.Certificate, error) {
+	if c.offlineVerify && c.rootCertPool == nil {
+		return nil, fmt.Errorf("appstore offline verify requires StoreConfig.RootCertificates to be configured")
+	}
+
+	rootCertBytes, err := c.cert.extractCertByIndex(jwsEncode, 2)
+	if err != nil {
+		return nil, err
+	}
 	rootCert, err := x509.ParseCertificate(rootCertBytes)
 	if err != nil {
-		return fmt.Errorf("appstore failed to parse root certificate")
+		return nil, fmt.Errorf("appstore failed to parse root certificate")
+	}
+	if !c.rootCertPool.contains(rootCert) {
+		return nil, fmt.Errorf("appstore root certificate is not in the pinned root pool")
 	}
 
 	intermediaCertBytes, err := c.cert.extractCertByIndex(jwsEncode, 1)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	intermediaCert, err := x509.ParseCertificate(intermediaCertBytes)
 	if err != nil {
-		return fmt.Errorf("appstore failed to parse intermediate certificate")
+		return nil, fmt.Errorf("appstore failed to parse intermediate certificate")
 	}
 
 	leafCertBytes, err := c.cert.extractCertByIndex(jwsEncode, 0)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	leafCert, err := x509.ParseCertificate(leafCertBytes)
 	if err != nil {
-		return fmt.Errorf("appstore failed to parse leaf certificate")
+		return nil, fmt.Errorf("appstore failed to parse leaf certificate")
 	}
-	if err = c.cert.verifyCert(rootCert, intermediaCert, leafCert); err != nil {
-		return err
+
+	if _, cached := c.leafKeys.get(string(leafCert.SubjectKeyId)); !cached {
+		if err := c.cert.verifyCert(rootCert, intermediaCert, leafCert); err != nil {
+			return nil, err
+		}
 	}
+	return leafCert, nil
+}
 
-	pk, ok := leafCert.PublicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return fmt.Errorf("appstore public key must be of type ecdsa.PublicKey")
+// VerifyJWS verifies token's x5c chain and returns the decoded claims
+// together with the leaf certificate that signed it, useful for auditing
+// which Apple signing key produced a payload.
+func (c *StoreClient) VerifyJWS(token string) (jwt.Claims, *x509.Certificate, error) {
+	leafCert, err := c.verifiedLeafCert(token)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	_, err = jwt.ParseWithClaims(jwsEncode, claims, func(token *jwt.Token) (interface{}, error) {
-		return pk, nil
-	})
-	return err
+	claims := &jwt.RegisteredClaims{}
+	if err := c.parseJWS(leafCert, token, claims); err != nil {
+		return nil, nil, err
+	}
+	return claims, leafCert, nil
 }
 
 func (c *StoreClient) ParseSignedTransaction(transaction string) (*JWSTransaction, error) {
 	tran := &JWSTransaction{}
-	err := c.parseJWS(transaction, tran)
+	err := c.decodeJWS(transaction, tran)
 	if err != nil {
 		return nil, err
 	}
+
+	if c.store != nil {
+		if err := c.store.PutTransaction(context.Background(), tran); err != nil {
+			return nil, err
+		}
+	}
 	return tran, nil
 }
 
@@ -489,7 +496,7 @@ func (c *StoreClient) Do(ctx context.Context, method string, url string, body io
 
 	req.Header.Set("Content-Type", "application/json")
 	req = req.WithContext(ctx)
-	resp, err := c.httpClient().Do(req)
+	resp, err := c.httpClient(endpointForURL(url)).Do(req)
 	if err != nil {
 		return 0, nil, fmt.Errorf("appstore http client do err %w", err)
 	}